@@ -0,0 +1,75 @@
+// adduser.go
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"golang.org/x/term"
+
+	"github.com/saurabhsadhalesuse/neuvector-analyser/auth"
+)
+
+// runAddUser implements `neuvector-analyser adduser <username>`, the
+// provisioning path for users.json: a fresh install has no accounts and
+// no way to log in until this is run at least once.
+func runAddUser(args []string) error {
+	fs := flag.NewFlagSet("adduser", flag.ContinueOnError)
+	usersPath := fs.String("users", usersFile, "path to the user store to provision")
+	saltPath := fs.String("salt", saltFile, "path to the Argon2id salt file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: neuvector-analyser adduser [-users <path>] [-salt <path>] <username>")
+	}
+	username := fs.Arg(0)
+
+	salt, err := auth.LoadOrCreateSalt(*saltPath)
+	if err != nil {
+		return fmt.Errorf("loading auth salt: %w", err)
+	}
+
+	password, err := readPassword()
+	if err != nil {
+		return err
+	}
+
+	store, err := auth.NewStore(*usersPath)
+	if err != nil {
+		return fmt.Errorf("loading user store: %w", err)
+	}
+	if err := store.SetPassword(username, auth.HashPassword(password, salt)); err != nil {
+		return fmt.Errorf("saving user store: %w", err)
+	}
+
+	fmt.Printf("added user %q to %s\n", username, *usersPath)
+	return nil
+}
+
+// readPassword prompts for a password twice on the terminal, without
+// echoing it, and confirms the two entries match.
+func readPassword() (string, error) {
+	fmt.Fprint(os.Stderr, "Password: ")
+	pw1, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("reading password: %w", err)
+	}
+
+	fmt.Fprint(os.Stderr, "Confirm password: ")
+	pw2, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("reading password confirmation: %w", err)
+	}
+
+	if len(pw1) == 0 {
+		return "", fmt.Errorf("password must not be empty")
+	}
+	if string(pw1) != string(pw2) {
+		return "", fmt.Errorf("passwords do not match")
+	}
+	return string(pw1), nil
+}
@@ -0,0 +1,233 @@
+// Package auth provides Argon2id password hashing and in-memory session
+// tracking for gating the analyser's /api/* routes.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2id parameters used for every password hash. These match the OWASP
+// baseline recommendation for interactive logins.
+const (
+	argonMemory      = 64 * 1024
+	argonIterations  = 3
+	argonParallelism = 2
+	argonKeyLength   = 32
+	argonSaltLength  = 16
+
+	sessionTokenBytes = 32
+)
+
+// HashPassword hashes password with Argon2id under the given salt and
+// returns it encoded as "$argon2id$v=19$m=...,t=...,p=...$<salt>$<hash>".
+func HashPassword(password string, salt []byte) string {
+	hash := argon2.IDKey([]byte(password), salt, argonIterations, argonMemory, argonParallelism, argonKeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, argonMemory, argonIterations, argonParallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(hash))
+}
+
+// VerifyPassword checks password against a hash produced by HashPassword,
+// using subtle.ConstantTimeCompare to avoid leaking timing information.
+func VerifyPassword(password, encodedHash string) (bool, error) {
+	version, memory, iterations, parallelism, salt, wantHash, err := decodeHash(encodedHash)
+	if err != nil {
+		return false, err
+	}
+	if version != argon2.Version {
+		return false, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+
+	gotHash := argon2.IDKey([]byte(password), salt, iterations, memory, parallelism, uint32(len(wantHash)))
+	return subtle.ConstantTimeCompare(gotHash, wantHash) == 1, nil
+}
+
+// decodeHash parses the "$argon2id$v=19$m=...,t=...,p=...$<salt>$<hash>"
+// format produced by HashPassword.
+func decodeHash(encoded string) (version int, memory, iterations uint32, parallelism uint8, salt, hash []byte, err error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return 0, 0, 0, 0, nil, nil, fmt.Errorf("invalid hash format")
+	}
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return 0, 0, 0, 0, nil, nil, fmt.Errorf("invalid hash version segment: %w", err)
+	}
+	if _, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &parallelism); err != nil {
+		return 0, 0, 0, 0, nil, nil, fmt.Errorf("invalid hash params segment: %w", err)
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return 0, 0, 0, 0, nil, nil, fmt.Errorf("invalid hash salt: %w", err)
+	}
+	if hash, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return 0, 0, 0, 0, nil, nil, fmt.Errorf("invalid hash digest: %w", err)
+	}
+	return version, memory, iterations, parallelism, salt, hash, nil
+}
+
+// LoadOrCreateSalt reads the per-install salt from path, generating and
+// persisting a fresh random one on first run.
+func LoadOrCreateSalt(path string) ([]byte, error) {
+	salt, err := ioutil.ReadFile(path)
+	if err == nil {
+		return salt, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("reading salt file: %w", err)
+	}
+
+	salt = make([]byte, argonSaltLength)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, fmt.Errorf("generating salt: %w", err)
+	}
+	if err := ioutil.WriteFile(path, salt, 0o600); err != nil {
+		return nil, fmt.Errorf("writing salt file: %w", err)
+	}
+	return salt, nil
+}
+
+// User is a single account in the user store.
+type User struct {
+	Username     string `json:"username"`
+	PasswordHash string `json:"password_hash"`
+}
+
+// Store is a file-backed set of users, keyed by username.
+type Store struct {
+	path string
+
+	mu    sync.RWMutex
+	users map[string]*User
+}
+
+// NewStore loads users from path (a JSON array of User), treating a missing
+// file as an empty store.
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path, users: make(map[string]*User)}
+
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading user store: %w", err)
+	}
+
+	var users []*User
+	if err := json.Unmarshal(raw, &users); err != nil {
+		return nil, fmt.Errorf("parsing user store: %w", err)
+	}
+	for _, u := range users {
+		s.users[u.Username] = u
+	}
+	return s, nil
+}
+
+// Authenticate reports whether username/password is a valid credential
+// pair.
+func (s *Store) Authenticate(username, password string) (bool, error) {
+	s.mu.RLock()
+	user, ok := s.users[username]
+	s.mu.RUnlock()
+	if !ok {
+		return false, nil
+	}
+	return VerifyPassword(password, user.PasswordHash)
+}
+
+// SetPassword adds or updates a user's password hash and persists the
+// store. It's the provisioning path for populating users.json.
+func (s *Store) SetPassword(username string, passwordHash string) error {
+	s.mu.Lock()
+	s.users[username] = &User{Username: username, PasswordHash: passwordHash}
+	err := s.save()
+	s.mu.Unlock()
+	return err
+}
+
+// save persists the store. Caller must hold s.mu.
+func (s *Store) save() error {
+	users := make([]*User, 0, len(s.users))
+	for _, u := range s.users {
+		users = append(users, u)
+	}
+	raw, err := json.MarshalIndent(users, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding user store: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, raw, 0o600); err != nil {
+		return fmt.Errorf("writing user store: %w", err)
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// Session is an authenticated login, tracked in memory only.
+type Session struct {
+	Username  string
+	ExpiresAt time.Time
+}
+
+// SessionManager tracks live session tokens in memory and expires them
+// after ttl.
+type SessionManager struct {
+	ttl time.Duration
+
+	mu       sync.RWMutex
+	sessions map[string]Session
+}
+
+// NewSessionManager creates a SessionManager whose tokens expire ttl after
+// creation.
+func NewSessionManager(ttl time.Duration) *SessionManager {
+	return &SessionManager{ttl: ttl, sessions: make(map[string]Session)}
+}
+
+// Create mints a new random session token for username.
+func (sm *SessionManager) Create(username string) (string, error) {
+	b := make([]byte, sessionTokenBytes)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", fmt.Errorf("generating session token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	sm.mu.Lock()
+	sm.sessions[token] = Session{Username: username, ExpiresAt: time.Now().Add(sm.ttl)}
+	sm.mu.Unlock()
+
+	return token, nil
+}
+
+// Lookup returns the session for token if it exists and hasn't expired.
+func (sm *SessionManager) Lookup(token string) (Session, bool) {
+	sm.mu.RLock()
+	sess, ok := sm.sessions[token]
+	sm.mu.RUnlock()
+	if !ok {
+		return Session{}, false
+	}
+	if time.Now().After(sess.ExpiresAt) {
+		sm.Revoke(token)
+		return Session{}, false
+	}
+	return sess, true
+}
+
+// Revoke deletes a session token, e.g. on logout.
+func (sm *SessionManager) Revoke(token string) {
+	sm.mu.Lock()
+	delete(sm.sessions, token)
+	sm.mu.Unlock()
+}
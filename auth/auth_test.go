@@ -0,0 +1,62 @@
+package auth
+
+import "testing"
+
+func TestHashPasswordVerifyPasswordRoundTrip(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+
+	tests := []struct {
+		name     string
+		password string
+	}{
+		{"simple password", "hunter2"},
+		{"empty password", ""},
+		{"unicode password", "correct-horse-battery-chéval"},
+		{"long password", string(make([]byte, 256))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash := HashPassword(tt.password, salt)
+
+			ok, err := VerifyPassword(tt.password, hash)
+			if err != nil {
+				t.Fatalf("VerifyPassword: %v", err)
+			}
+			if !ok {
+				t.Fatalf("VerifyPassword(%q, %q) = false, want true", tt.password, hash)
+			}
+
+			ok, err = VerifyPassword(tt.password+"x", hash)
+			if err != nil {
+				t.Fatalf("VerifyPassword with wrong password: %v", err)
+			}
+			if ok {
+				t.Fatalf("VerifyPassword with wrong password = true, want false")
+			}
+		})
+	}
+}
+
+func TestVerifyPasswordRejectsMalformedHash(t *testing.T) {
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{"empty string", ""},
+		{"wrong algorithm", "$bcrypt$v=19$m=65536,t=3,p=2$c2FsdA$aGFzaA"},
+		{"too few segments", "$argon2id$v=19$m=65536,t=3,p=2$c2FsdA"},
+		{"bad version segment", "$argon2id$version=19$m=65536,t=3,p=2$c2FsdA$aGFzaA"},
+		{"bad params segment", "$argon2id$v=19$bogus$c2FsdA$aGFzaA"},
+		{"bad salt encoding", "$argon2id$v=19$m=65536,t=3,p=2$not-base64!$aGFzaA"},
+		{"bad hash encoding", "$argon2id$v=19$m=65536,t=3,p=2$c2FsdA$not-base64!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := VerifyPassword("whatever", tt.hash); err == nil {
+				t.Fatalf("VerifyPassword(%q) returned no error, want one", tt.hash)
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+// bundle.go
+package main
+
+import (
+	"container/list"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// defaultBundleDir is where uploaded support bundles are stored on disk.
+const defaultBundleDir = "bundles"
+
+// maxCachedBundles bounds how many decoded bundles are kept in memory at once.
+const maxCachedBundles = 4
+
+// maxUploadBundleBytes bounds how large a single multipart bundle upload
+// may be, so an authenticated user can't fill the bundle disk with an
+// arbitrarily large (or unbounded, e.g. a client that never closes the
+// request body) upload. Support bundles are meant to be held long-term,
+// several at a time, so this is generous rather than tight.
+const maxUploadBundleBytes = 1 << 30 // 1 GiB
+
+// BundleMeta describes a single uploaded support bundle.
+type BundleMeta struct {
+	ID          string    `json:"id"`
+	Filename    string    `json:"filename"`
+	UploadedAt  time.Time `json:"uploaded_at"`
+	Size        int64     `json:"size"`
+	ClusterName string    `json:"cluster_name"`
+}
+
+// cachedBundle holds the decoded form of a bundle, guarded by its own lock so
+// that concurrent requests against different bundles never contend.
+type cachedBundle struct {
+	id   string
+	mu   sync.RWMutex
+	view bundleView
+}
+
+// BundleManager owns the on-disk bundle store plus a bounded LRU of decoded
+// bundles. It replaces the old single `neuvectorData` global so the server
+// can hold more than one support bundle at a time.
+type BundleManager struct {
+	dir       string
+	indexPath string
+
+	mu   sync.RWMutex // protects meta and the LRU bookkeeping below
+	meta map[string]*BundleMeta
+
+	lruList *list.List               // front = most recently used
+	lruElem map[string]*list.Element // id -> element in lruList, value is *cachedBundle
+}
+
+// NewBundleManager creates the bundle directory if needed and loads the
+// existing index, if any.
+func NewBundleManager(dir string) (*BundleManager, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating bundle dir %s: %w", dir, err)
+	}
+	bm := &BundleManager{
+		dir:       dir,
+		indexPath: filepath.Join(dir, "index.json"),
+		meta:      make(map[string]*BundleMeta),
+		lruList:   list.New(),
+		lruElem:   make(map[string]*list.Element),
+	}
+	if err := bm.loadIndex(); err != nil {
+		return nil, err
+	}
+	return bm, nil
+}
+
+func (bm *BundleManager) loadIndex() error {
+	raw, err := ioutil.ReadFile(bm.indexPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading bundle index: %w", err)
+	}
+	var entries []*BundleMeta
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return fmt.Errorf("parsing bundle index: %w", err)
+	}
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	for _, m := range entries {
+		bm.meta[m.ID] = m
+	}
+	return nil
+}
+
+// saveIndex persists the current metadata set. Caller must hold bm.mu.
+func (bm *BundleManager) saveIndex() error {
+	entries := make([]*BundleMeta, 0, len(bm.meta))
+	for _, m := range bm.meta {
+		entries = append(entries, m)
+	}
+	raw, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding bundle index: %w", err)
+	}
+	tmp := bm.indexPath + ".tmp"
+	if err := ioutil.WriteFile(tmp, raw, 0o644); err != nil {
+		return fmt.Errorf("writing bundle index: %w", err)
+	}
+	return os.Rename(tmp, bm.indexPath)
+}
+
+func (bm *BundleManager) pathFor(id string) string {
+	return filepath.Join(bm.dir, id+".json.gz")
+}
+
+// Upload decompresses just enough of the bundle to pull the cluster name out
+// of /v1/system/config, stores the raw gzip on disk, and records it in the
+// index.
+func (bm *BundleManager) Upload(filename string, r io.Reader) (*BundleMeta, error) {
+	id := newBundleID()
+	dest := bm.pathFor(id)
+
+	f, err := os.Create(dest)
+	if err != nil {
+		return nil, fmt.Errorf("creating bundle file: %w", err)
+	}
+	size, err := io.Copy(f, r)
+	closeErr := f.Close()
+	if err != nil {
+		os.Remove(dest)
+		return nil, fmt.Errorf("writing bundle file: %w", err)
+	}
+	if closeErr != nil {
+		os.Remove(dest)
+		return nil, fmt.Errorf("closing bundle file: %w", closeErr)
+	}
+
+	view, err := loadBundleView(dest)
+	if err != nil {
+		os.Remove(dest)
+		return nil, fmt.Errorf("decoding uploaded bundle: %w", err)
+	}
+
+	meta := &BundleMeta{
+		ID:          id,
+		Filename:    filename,
+		UploadedAt:  time.Now(),
+		Size:        size,
+		ClusterName: clusterNameFromView(view),
+	}
+
+	bm.mu.Lock()
+	bm.meta[id] = meta
+	err = bm.saveIndex()
+	bm.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	bm.cachePut(id, view)
+	return meta, nil
+}
+
+// List returns the metadata for every stored bundle.
+func (bm *BundleManager) List() []*BundleMeta {
+	bm.mu.RLock()
+	defer bm.mu.RUnlock()
+	out := make([]*BundleMeta, 0, len(bm.meta))
+	for _, m := range bm.meta {
+		out = append(out, m)
+	}
+	return out
+}
+
+// Delete removes a bundle from disk, the index, and the decoded cache.
+func (bm *BundleManager) Delete(id string) error {
+	bm.mu.Lock()
+	_, ok := bm.meta[id]
+	if !ok {
+		bm.mu.Unlock()
+		return os.ErrNotExist
+	}
+	delete(bm.meta, id)
+	err := bm.saveIndex()
+	if elem, cached := bm.lruElem[id]; cached {
+		bm.lruList.Remove(elem)
+		delete(bm.lruElem, id)
+		closeView(elem.Value.(*cachedBundle).view)
+	}
+	bm.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.Remove(bm.pathFor(id))
+}
+
+// View returns the bundleView for a bundle (eager or streaming, depending
+// on its size), populating the LRU cache on a miss.
+func (bm *BundleManager) View(id string) (bundleView, error) {
+	bm.mu.RLock()
+	_, ok := bm.meta[id]
+	bm.mu.RUnlock()
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	if cb := bm.cacheGet(id); cb != nil {
+		cb.mu.RLock()
+		defer cb.mu.RUnlock()
+		return cb.view, nil
+	}
+
+	view, err := loadBundleView(bm.pathFor(id))
+	if err != nil {
+		return nil, err
+	}
+	bm.cachePut(id, view)
+	return view, nil
+}
+
+// cacheGet touches the LRU on hit.
+func (bm *BundleManager) cacheGet(id string) *cachedBundle {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	elem, ok := bm.lruElem[id]
+	if !ok {
+		return nil
+	}
+	bm.lruList.MoveToFront(elem)
+	return elem.Value.(*cachedBundle)
+}
+
+// cachePut inserts or refreshes a decoded bundle, evicting (and closing) the
+// least recently used entry once the cache is over capacity.
+func (bm *BundleManager) cachePut(id string, view bundleView) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	if elem, ok := bm.lruElem[id]; ok {
+		old := elem.Value.(*cachedBundle)
+		old.mu.Lock()
+		old.view = view
+		old.mu.Unlock()
+		bm.lruList.MoveToFront(elem)
+		return
+	}
+
+	cb := &cachedBundle{id: id, view: view}
+	elem := bm.lruList.PushFront(cb)
+	bm.lruElem[id] = elem
+
+	for bm.lruList.Len() > maxCachedBundles {
+		oldest := bm.lruList.Back()
+		if oldest == nil {
+			break
+		}
+		bm.lruList.Remove(oldest)
+		evicted := oldest.Value.(*cachedBundle)
+		delete(bm.lruElem, evicted.id)
+		evicted.mu.Lock()
+		closeView(evicted.view)
+		evicted.mu.Unlock()
+	}
+}
+
+// closeView releases resources (e.g. a streamingView's temp file) held by a
+// cached view, if it holds any. streamingView.Close defers the actual file
+// removal until any of its Get/GetArrayField calls already in flight
+// finish, so a concurrent reader that grabbed this view from View() just
+// before eviction doesn't see its temp file vanish mid-read.
+func closeView(view bundleView) {
+	if closer, ok := view.(interface{ Close() error }); ok {
+		closer.Close()
+	}
+}
+
+// clusterNameFromView pulls the cluster name out of /v1/system/config, if
+// present, for display in the bundle list.
+func clusterNameFromView(view bundleView) string {
+	val, ok, err := view.Get("/v1/system/config")
+	if err != nil || !ok {
+		return ""
+	}
+	cfg, ok := val.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	if name, ok := cfg["cluster_name"].(string); ok {
+		return name
+	}
+	return ""
+}
+
+// newBundleID generates a filesystem- and URL-safe identifier for a newly
+// uploaded bundle.
+func newBundleID() string {
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		// Extremely unlikely; fall back to a timestamp-derived id rather
+		// than fail the upload outright.
+		return fmt.Sprintf("bundle-%d", time.Now().UnixNano())
+	}
+	return fmt.Sprintf("%x", b)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"testing"
+)
+
+// smallGzippedBundle returns a reader over a tiny valid support bundle, for
+// tests that just need BundleManager.Upload to succeed.
+func smallGzippedBundle(t *testing.T, clusterName string) *os.File {
+	t.Helper()
+	data := map[string]interface{}{
+		"/v1/system/config": map[string]interface{}{"cluster_name": clusterName},
+		"/v1/group":         map[string]interface{}{"groups": []interface{}{map[string]interface{}{"name": "g1"}}},
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		t.Fatalf("marshaling fixture: %v", err)
+	}
+
+	path := t.TempDir() + "/bundle.json.gz"
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("creating fixture file: %v", err)
+	}
+	gw := gzip.NewWriter(f)
+	if _, err := gw.Write(raw); err != nil {
+		t.Fatalf("writing gzip data: %v", err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatalf("closing gzip writer: %v", err)
+	}
+	if _, err := f.Seek(0, os.SEEK_SET); err != nil {
+		t.Fatalf("rewinding fixture file: %v", err)
+	}
+	return f
+}
+
+func TestCachePutEvictsLeastRecentlyUsed(t *testing.T) {
+	bm, err := NewBundleManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewBundleManager: %v", err)
+	}
+
+	var ids []string
+	for i := 0; i < maxCachedBundles+1; i++ {
+		f := smallGzippedBundle(t, "cluster")
+		meta, err := bm.Upload("bundle.json.gz", f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("Upload #%d: %v", i, err)
+		}
+		ids = append(ids, meta.ID)
+	}
+
+	if len(bm.lruElem) != maxCachedBundles {
+		t.Fatalf("cache holds %d entries, want %d", len(bm.lruElem), maxCachedBundles)
+	}
+	if _, cached := bm.lruElem[ids[0]]; cached {
+		t.Errorf("first-uploaded bundle %q is still cached, want it evicted", ids[0])
+	}
+	for _, id := range ids[1:] {
+		if _, cached := bm.lruElem[id]; !cached {
+			t.Errorf("bundle %q was evicted, want it still cached", id)
+		}
+	}
+
+	// Metadata and the on-disk file survive eviction; only the decoded
+	// view is dropped from the LRU.
+	if _, err := bm.View(ids[0]); err != nil {
+		t.Errorf("View(%q) after eviction: %v", ids[0], err)
+	}
+}
+
+// TestCachePutEvictionDoesNotRaceConcurrentRead exercises the case
+// cachePut's eviction lock guards against: a view already handed out by
+// View() is being read from while it's concurrently evicted (and closed)
+// by a flurry of new uploads pushing it out of the LRU. Run with -race.
+func TestCachePutEvictionDoesNotRaceConcurrentRead(t *testing.T) {
+	bm, err := NewBundleManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewBundleManager: %v", err)
+	}
+
+	f := smallGzippedBundle(t, "cluster")
+	meta, err := bm.Upload("first.json.gz", f)
+	f.Close()
+	if err != nil {
+		t.Fatalf("initial Upload: %v", err)
+	}
+
+	view, err := bm.View(meta.ID)
+	if err != nil {
+		t.Fatalf("View: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		ctx := context.Background()
+		for i := 0; i < 20; i++ {
+			if _, _, err := view.Get("/v1/system/config"); err != nil {
+				t.Errorf("Get during eviction: %v", err)
+			}
+			view.GetArrayField(ctx, "/v1/group", "groups", func(el interface{}) (bool, error) {
+				return true, nil
+			})
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < maxCachedBundles+4; i++ {
+			uf := smallGzippedBundle(t, "cluster")
+			if _, err := bm.Upload("filler.json.gz", uf); err != nil {
+				t.Errorf("filler Upload #%d: %v", i, err)
+			}
+			uf.Close()
+		}
+	}()
+
+	wg.Wait()
+}
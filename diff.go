@@ -0,0 +1,141 @@
+// diff.go
+package main
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// diffSpec describes how to pull a comparable, keyed array out of the raw
+// decoded value for one of the specialized /v1/* keys.
+type diffSpec struct {
+	arrayField string // e.g. "groups", "hosts"
+	idField    string // e.g. "name", "platform"
+}
+
+// diffSpecs maps the keys the cross-bundle diff endpoint understands to how
+// their arrays are shaped, mirroring the wrapper keys getDataHandler already
+// knows about for /v1/group, /v1/host, /v1/domain, and /v1/scan/platform.
+var diffSpecs = map[string]diffSpec{
+	"/v1/group":         {arrayField: "groups", idField: "name"},
+	"/v1/host":          {arrayField: "hosts", idField: "name"},
+	"/v1/domain":        {arrayField: "domains", idField: "name"},
+	"/v1/scan/platform": {arrayField: "platforms", idField: "platform"},
+}
+
+// FieldChange describes how a single field moved between the two sides of a
+// diff, e.g. a policy_mode transition or a scan_summary.high delta.
+type FieldChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// ChangedItem is an entry present on both sides of a diff whose fields
+// differ.
+type ChangedItem struct {
+	ID     string        `json:"id"`
+	Fields []FieldChange `json:"fields"`
+}
+
+// Diff is the result of comparing two keyed arrays.
+type Diff struct {
+	Added   []interface{} `json:"added"`
+	Removed []interface{} `json:"removed"`
+	Changed []ChangedItem `json:"changed"`
+}
+
+// diffSlicesByKey compares two arrays of objects keyed by idField (e.g.
+// "name" for groups/domains/hosts, "platform" for platforms) and reports
+// additions, removals, and per-field changes for entries present on both
+// sides. It's the one piece of machinery behind every specialized diff
+// endpoint, so a bug fixed here fixes all of them.
+func diffSlicesByKey(left, right []interface{}, idField string) Diff {
+	leftByID := indexByField(left, idField)
+	rightByID := indexByField(right, idField)
+
+	d := Diff{
+		Added:   []interface{}{},
+		Removed: []interface{}{},
+		Changed: []ChangedItem{},
+	}
+
+	for id, rightItem := range rightByID {
+		leftItem, ok := leftByID[id]
+		if !ok {
+			d.Added = append(d.Added, rightItem)
+			continue
+		}
+		if fields := diffFields(leftItem, rightItem); len(fields) > 0 {
+			d.Changed = append(d.Changed, ChangedItem{ID: id, Fields: fields})
+		}
+	}
+	for id, leftItem := range leftByID {
+		if _, ok := rightByID[id]; !ok {
+			d.Removed = append(d.Removed, leftItem)
+		}
+	}
+
+	return d
+}
+
+// indexByField builds an id -> item map from an array of
+// map[string]interface{}, skipping entries that aren't maps or don't carry
+// the id field as a string.
+func indexByField(items []interface{}, idField string) map[string]map[string]interface{} {
+	out := make(map[string]map[string]interface{}, len(items))
+	for _, itemIface := range items {
+		item, ok := itemIface.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		id, ok := item[idField].(string)
+		if !ok {
+			continue
+		}
+		out[id] = item
+	}
+	return out
+}
+
+// diffFields compares two objects field by field, descending one level into
+// nested objects (e.g. scan_summary.high) so deltas there show up as their
+// own FieldChange rather than a single opaque "scan_summary changed".
+func diffFields(left, right map[string]interface{}) []FieldChange {
+	flatLeft := flattenOneLevel(left)
+	flatRight := flattenOneLevel(right)
+
+	seen := make(map[string]bool, len(flatLeft)+len(flatRight))
+	var changes []FieldChange
+	for field, leftVal := range flatLeft {
+		seen[field] = true
+		rightVal, ok := flatRight[field]
+		if !ok || !reflect.DeepEqual(leftVal, rightVal) {
+			changes = append(changes, FieldChange{Field: field, Before: leftVal, After: rightVal})
+		}
+	}
+	for field, rightVal := range flatRight {
+		if seen[field] {
+			continue
+		}
+		changes = append(changes, FieldChange{Field: field, Before: nil, After: rightVal})
+	}
+	return changes
+}
+
+// flattenOneLevel turns nested maps like {"scan_summary": {"high": 3}} into
+// {"scan_summary.high": 3} so callers can diff and display individual
+// sub-fields such as scan_summary.high/medium or zero_drift_enabled.
+func flattenOneLevel(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		if nested, ok := v.(map[string]interface{}); ok {
+			for nk, nv := range nested {
+				out[fmt.Sprintf("%s.%s", k, nk)] = nv
+			}
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,111 @@
+package main
+
+import "testing"
+
+func TestDiffSlicesByKey(t *testing.T) {
+	left := []interface{}{
+		map[string]interface{}{"name": "alpha", "policy_mode": "monitor"},
+		map[string]interface{}{"name": "beta", "policy_mode": "protect"},
+		map[string]interface{}{"name": "gamma", "policy_mode": "discover"},
+	}
+	right := []interface{}{
+		map[string]interface{}{"name": "beta", "policy_mode": "protect"},
+		map[string]interface{}{"name": "gamma", "policy_mode": "protect"},
+		map[string]interface{}{"name": "delta", "policy_mode": "monitor"},
+	}
+
+	d := diffSlicesByKey(left, right, "name")
+
+	if len(d.Added) != 1 || d.Added[0].(map[string]interface{})["name"] != "delta" {
+		t.Errorf("Added = %v, want just 'delta'", d.Added)
+	}
+	if len(d.Removed) != 1 || d.Removed[0].(map[string]interface{})["name"] != "alpha" {
+		t.Errorf("Removed = %v, want just 'alpha'", d.Removed)
+	}
+	if len(d.Changed) != 1 || d.Changed[0].ID != "gamma" {
+		t.Fatalf("Changed = %v, want just 'gamma'", d.Changed)
+	}
+	fc := d.Changed[0].Fields
+	if len(fc) != 1 || fc[0].Field != "policy_mode" || fc[0].Before != "discover" || fc[0].After != "protect" {
+		t.Errorf("Changed['gamma'].Fields = %+v, want a single policy_mode discover->protect change", fc)
+	}
+}
+
+func TestDiffSlicesByKeySkipsUnkeyableItems(t *testing.T) {
+	left := []interface{}{
+		"not a map",
+		map[string]interface{}{"no_name_field": true},
+		map[string]interface{}{"name": "alpha"},
+	}
+	right := []interface{}{
+		map[string]interface{}{"name": "alpha"},
+	}
+
+	d := diffSlicesByKey(left, right, "name")
+	if len(d.Added) != 0 || len(d.Removed) != 0 || len(d.Changed) != 0 {
+		t.Errorf("got Added=%v Removed=%v Changed=%v, want no diff (unkeyable items ignored)", d.Added, d.Removed, d.Changed)
+	}
+}
+
+func TestFlattenOneLevel(t *testing.T) {
+	in := map[string]interface{}{
+		"name": "host1",
+		"scan_summary": map[string]interface{}{
+			"high":   3,
+			"medium": 1,
+		},
+	}
+
+	out := flattenOneLevel(in)
+
+	want := map[string]interface{}{
+		"name":                "host1",
+		"scan_summary.high":   3,
+		"scan_summary.medium": 1,
+	}
+	if len(out) != len(want) {
+		t.Fatalf("flattenOneLevel(%v) = %v, want %v", in, out, want)
+	}
+	for k, v := range want {
+		if out[k] != v {
+			t.Errorf("flattenOneLevel(%v)[%q] = %v, want %v", in, k, out[k], v)
+		}
+	}
+}
+
+func TestDiffFieldsDescendsNestedObjectsAndReportsMissingFields(t *testing.T) {
+	left := map[string]interface{}{
+		"name": "host1",
+		"scan_summary": map[string]interface{}{
+			"high": 3,
+		},
+		"only_on_left": "x",
+	}
+	right := map[string]interface{}{
+		"name": "host1",
+		"scan_summary": map[string]interface{}{
+			"high": 5,
+		},
+		"only_on_right": "y",
+	}
+
+	changes := diffFields(left, right)
+
+	byField := make(map[string]FieldChange, len(changes))
+	for _, c := range changes {
+		byField[c.Field] = c
+	}
+
+	if c, ok := byField["scan_summary.high"]; !ok || c.Before != 3 || c.After != 5 {
+		t.Errorf("scan_summary.high change = %+v, want before=3 after=5", c)
+	}
+	if c, ok := byField["only_on_left"]; !ok || c.Before != "x" || c.After != nil {
+		t.Errorf("only_on_left change = %+v, want before=x after=nil", c)
+	}
+	if c, ok := byField["only_on_right"]; !ok || c.Before != nil || c.After != "y" {
+		t.Errorf("only_on_right change = %+v, want before=nil after=y", c)
+	}
+	if _, ok := byField["name"]; ok {
+		t.Errorf("unchanged field 'name' should not appear in diff, got %+v", byField["name"])
+	}
+}
@@ -0,0 +1,433 @@
+// loader.go
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// errKeyNotFound is returned by bundleView.HasArrayField when the
+// top-level key itself is absent, as opposed to present but malformed --
+// callers use this to tell a 404 ("no such key") from a 500 ("bundle data
+// doesn't look like we expect").
+var errKeyNotFound = errors.New("key not found")
+
+// streamingSizeThreshold is the decompressed bundle size above which the
+// indexed streaming loader is used instead of the eager whole-file
+// json.Unmarshal path. Support bundles are highly compressible JSON, so
+// this is measured after gunzipping rather than off the gzip file's size
+// on disk -- otherwise a 10-20MiB gzip that expands to 150-200MiB would
+// slip under the threshold and still go through the eager path. Small
+// bundles still go through the eager path, since the cost of building and
+// seeking a temp-file index outweighs the savings for them.
+const streamingSizeThreshold = 50 * 1024 * 1024 // 50 MiB
+
+// byteRange locates a top-level value's raw JSON bytes inside the
+// decompressed temp file backing a streamingView.
+type byteRange struct {
+	Offset int64
+	Length int64
+}
+
+// bundleView abstracts over how a decoded bundle is stored so
+// getKeysHandler/getDataHandler/diffableArray don't care whether the
+// underlying bundle was small enough to unmarshal eagerly or large enough
+// to warrant the indexed streaming loader.
+type bundleView interface {
+	// Keys returns every top-level key in the bundle.
+	Keys() []string
+	// Get decodes and returns the value for a top-level key.
+	Get(key string) (interface{}, bool, error)
+	// GetArrayField streams the array stored at key's field (e.g.
+	// /v1/group's "groups"), calling emit for each decoded element in
+	// turn. emit returns false (or ctx is done) to stop early without
+	// decoding the rest of the array. The bool result reports whether
+	// key and field were both found.
+	GetArrayField(ctx context.Context, key, field string, emit func(el interface{}) (bool, error)) (bool, error)
+	// HasArrayField reports, without decoding any array elements, whether
+	// key's field holds an array: nil if it does, errKeyNotFound if key
+	// itself is absent, or another error describing the shape mismatch.
+	// Callers validate with this before committing a streamed response,
+	// since once that starts there's no way to turn a 200 back into a
+	// 404/500.
+	HasArrayField(key, field string) error
+}
+
+// eagerView wraps a bundle that was fully unmarshalled into memory, the
+// original behavior of loadData/decodeBundleFile.
+type eagerView struct {
+	data map[string]interface{}
+}
+
+func (v *eagerView) Keys() []string {
+	keys := make([]string, 0, len(v.data))
+	for k := range v.data {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (v *eagerView) Get(key string) (interface{}, bool, error) {
+	val, ok := v.data[key]
+	return val, ok, nil
+}
+
+func (v *eagerView) GetArrayField(ctx context.Context, key, field string, emit func(interface{}) (bool, error)) (bool, error) {
+	val, ok := v.data[key]
+	if !ok {
+		return false, nil
+	}
+	valMap, ok := val.(map[string]interface{})
+	if !ok {
+		return true, fmt.Errorf("key '%s' is not an object", key)
+	}
+	arr, ok := valMap[field].([]interface{})
+	if !ok {
+		return true, fmt.Errorf("key '%s' has no '%s' array", key, field)
+	}
+
+	for _, el := range arr {
+		if err := ctx.Err(); err != nil {
+			return true, err
+		}
+		cont, err := emit(el)
+		if err != nil {
+			return true, err
+		}
+		if !cont {
+			break
+		}
+	}
+	return true, nil
+}
+
+func (v *eagerView) HasArrayField(key, field string) error {
+	val, ok := v.data[key]
+	if !ok {
+		return errKeyNotFound
+	}
+	valMap, ok := val.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("key '%s' is not an object", key)
+	}
+	if _, ok := valMap[field].([]interface{}); !ok {
+		return fmt.Errorf("key '%s' has no '%s' array", key, field)
+	}
+	return nil
+}
+
+// streamingView wraps a bundle indexed by loadBundleView: only the
+// (offset, length) of each top-level value's raw JSON is kept in memory,
+// and a key is decoded on demand by seeking into tempPath.
+type streamingView struct {
+	tempPath string
+	index    map[string]byteRange
+
+	mu       sync.Mutex
+	closed   bool
+	inFlight int
+}
+
+// acquire marks a read against tempPath in progress, so Close doesn't
+// remove the file out from under it. It errors once Close has been
+// called, since that only happens after this view has been evicted from
+// the bundle manager's LRU and shouldn't be read from again.
+func (v *streamingView) acquire() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.closed {
+		return fmt.Errorf("bundle view closed")
+	}
+	v.inFlight++
+	return nil
+}
+
+// release ends a read started by acquire, removing tempPath if Close was
+// called while it was in flight.
+func (v *streamingView) release() {
+	v.mu.Lock()
+	v.inFlight--
+	shouldRemove := v.closed && v.inFlight == 0
+	v.mu.Unlock()
+	if shouldRemove {
+		os.Remove(v.tempPath)
+	}
+}
+
+func (v *streamingView) Keys() []string {
+	keys := make([]string, 0, len(v.index))
+	for k := range v.index {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (v *streamingView) Get(key string) (interface{}, bool, error) {
+	rng, ok := v.index[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if err := v.acquire(); err != nil {
+		return nil, true, err
+	}
+	defer v.release()
+
+	f, err := os.Open(v.tempPath)
+	if err != nil {
+		return nil, true, fmt.Errorf("opening streamed bundle: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(rng.Offset, io.SeekStart); err != nil {
+		return nil, true, fmt.Errorf("seeking to key '%s': %w", key, err)
+	}
+
+	var val interface{}
+	dec := json.NewDecoder(io.LimitReader(f, rng.Length))
+	if err := dec.Decode(&val); err != nil {
+		return nil, true, fmt.Errorf("decoding key '%s': %w", key, err)
+	}
+	return val, true, nil
+}
+
+// openArrayField seeks to key's byte range and walks its object fields
+// until it finds field, leaving dec positioned right after that array's
+// opening '['. The caller must invoke the returned cleanup func exactly
+// once (whether or not it goes on to read the array), which closes the
+// temp file and releases the acquire() taken on v's behalf.
+func (v *streamingView) openArrayField(key, field string) (dec *json.Decoder, cleanup func(), err error) {
+	rng, ok := v.index[key]
+	if !ok {
+		return nil, nil, errKeyNotFound
+	}
+	if err := v.acquire(); err != nil {
+		return nil, nil, err
+	}
+
+	f, err := os.Open(v.tempPath)
+	if err != nil {
+		v.release()
+		return nil, nil, fmt.Errorf("opening streamed bundle: %w", err)
+	}
+	cleanup = func() {
+		f.Close()
+		v.release()
+	}
+
+	if _, err := f.Seek(rng.Offset, io.SeekStart); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("seeking to key '%s': %w", key, err)
+	}
+
+	dec = json.NewDecoder(io.LimitReader(f, rng.Length))
+	if tok, err := dec.Token(); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("reading object start for key '%s': %w", key, err)
+	} else if tok != json.Delim('{') {
+		cleanup()
+		return nil, nil, fmt.Errorf("key '%s' is not an object", key)
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("reading field name in '%s': %w", key, err)
+		}
+		fieldName, _ := tok.(string)
+		if fieldName != field {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				cleanup()
+				return nil, nil, fmt.Errorf("skipping field '%s' in '%s': %w", fieldName, key, err)
+			}
+			continue
+		}
+
+		arrTok, err := dec.Token()
+		if err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("reading array start for '%s.%s': %w", key, field, err)
+		}
+		if arrTok != json.Delim('[') {
+			cleanup()
+			return nil, nil, fmt.Errorf("key '%s' field '%s' is not an array", key, field)
+		}
+		return dec, cleanup, nil
+	}
+
+	cleanup()
+	return nil, nil, fmt.Errorf("key '%s' has no '%s' array", key, field)
+}
+
+func (v *streamingView) GetArrayField(ctx context.Context, key, field string, emit func(interface{}) (bool, error)) (bool, error) {
+	dec, cleanup, err := v.openArrayField(key, field)
+	if err != nil {
+		if err == errKeyNotFound {
+			return false, nil
+		}
+		return true, err
+	}
+	defer cleanup()
+
+	for dec.More() {
+		if err := ctx.Err(); err != nil {
+			return true, err
+		}
+		var el interface{}
+		if err := dec.Decode(&el); err != nil {
+			return true, fmt.Errorf("decoding element of '%s.%s': %w", key, field, err)
+		}
+		cont, err := emit(el)
+		if err != nil {
+			return true, err
+		}
+		if !cont {
+			return true, nil
+		}
+	}
+	return true, nil
+}
+
+// HasArrayField walks just far enough to confirm key's field is an array,
+// without decoding any of its elements.
+func (v *streamingView) HasArrayField(key, field string) error {
+	_, cleanup, err := v.openArrayField(key, field)
+	if err != nil {
+		return err
+	}
+	cleanup()
+	return nil
+}
+
+// Close removes the decompressed temp file backing this view, deferring
+// the removal until any Get/GetArrayField calls already in flight finish.
+// It's called when the view is evicted from the bundle manager's LRU.
+func (v *streamingView) Close() error {
+	v.mu.Lock()
+	v.closed = true
+	inFlight := v.inFlight
+	v.mu.Unlock()
+	if inFlight > 0 {
+		return nil
+	}
+	return os.Remove(v.tempPath)
+}
+
+// loadBundleView decompresses the gzipped bundle at path into a temp file
+// and picks the eager or streaming loader based on the *decompressed*
+// size, so the threshold reflects the actual JSON payload a handler would
+// have to hold in memory.
+func loadBundleView(path string) (bundleView, error) {
+	tempPath, size, err := decompressToTemp(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if size < streamingSizeThreshold {
+		data, err := decodeTempFile(tempPath)
+		os.Remove(tempPath)
+		if err != nil {
+			return nil, err
+		}
+		return &eagerView{data: data}, nil
+	}
+
+	index, err := indexTopLevelKeys(tempPath)
+	if err != nil {
+		os.Remove(tempPath)
+		return nil, err
+	}
+	return &streamingView{tempPath: tempPath, index: index}, nil
+}
+
+// decompressToTemp gunzips the bundle at path into a temp file, returning
+// its path and decompressed size.
+func decompressToTemp(path string) (tempPath string, size int64, err error) {
+	gzFile, err := os.Open(path)
+	if err != nil {
+		return "", 0, fmt.Errorf("opening gzipped bundle: %w", err)
+	}
+	defer gzFile.Close()
+
+	gzr, err := gzip.NewReader(gzFile)
+	if err != nil {
+		return "", 0, fmt.Errorf("creating gzip reader: %w", err)
+	}
+	defer gzr.Close()
+
+	tmp, err := os.CreateTemp("", "nvbundle-*.json")
+	if err != nil {
+		return "", 0, fmt.Errorf("creating decompressed temp file: %w", err)
+	}
+	tempPath = tmp.Name()
+
+	n, err := io.Copy(tmp, gzr)
+	if err != nil {
+		tmp.Close()
+		os.Remove(tempPath)
+		return "", 0, fmt.Errorf("decompressing bundle to temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tempPath)
+		return "", 0, fmt.Errorf("closing decompressed temp file: %w", err)
+	}
+	return tempPath, n, nil
+}
+
+// decodeTempFile parses an already-decompressed bundle temp file.
+func decodeTempFile(path string) (map[string]interface{}, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading decompressed bundle: %w", err)
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("parsing bundle JSON: %w", err)
+	}
+	return data, nil
+}
+
+// indexTopLevelKeys walks the top-level object in the file at path and
+// records the byte range of each key's raw value.
+func indexTopLevelKeys(path string) (map[string]byteRange, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening decompressed bundle: %w", err)
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	if _, err := dec.Token(); err != nil { // consume leading '{'
+		return nil, fmt.Errorf("reading top-level object start: %w", err)
+	}
+
+	index := make(map[string]byteRange)
+	for dec.More() {
+		keyTok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("reading top-level key: %w", err)
+		}
+		key, ok := keyTok.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected non-string top-level key %v", keyTok)
+		}
+
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, fmt.Errorf("reading value for key '%s': %w", key, err)
+		}
+
+		end := dec.InputOffset()
+		length := int64(len(raw))
+		index[key] = byteRange{Offset: end - length, Length: length}
+	}
+
+	return index, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeGzippedBundle gzips a JSON object with a single "/v1/pad" key whose
+// value is a string of padLen bytes, so the decompressed size lands just
+// above or below streamingSizeThreshold regardless of how well gzip
+// compresses it.
+func writeGzippedBundle(t *testing.T, padLen int) string {
+	t.Helper()
+	data := map[string]interface{}{
+		"/v1/pad": strings.Repeat("x", padLen),
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		t.Fatalf("marshaling fixture: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "bundle.json.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("creating bundle file: %v", err)
+	}
+	defer f.Close()
+
+	gw := gzip.NewWriter(f)
+	if _, err := gw.Write(raw); err != nil {
+		t.Fatalf("writing gzip data: %v", err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatalf("closing gzip writer: %v", err)
+	}
+	return path
+}
+
+func TestLoadBundleViewPicksEagerOrStreamingByDecompressedSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		padLen  int
+		wantVal bool // true if we expect *eagerView, false for *streamingView
+	}{
+		{"well under threshold", 1024, true},
+		{"well over threshold", streamingSizeThreshold + 1024*1024, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeGzippedBundle(t, tt.padLen)
+			view, err := loadBundleView(path)
+			if err != nil {
+				t.Fatalf("loadBundleView: %v", err)
+			}
+			defer closeView(view)
+
+			_, isEager := view.(*eagerView)
+			if isEager != tt.wantVal {
+				t.Errorf("loadBundleView(padLen=%d) eager=%v, want %v", tt.padLen, isEager, tt.wantVal)
+			}
+		})
+	}
+}
+
+func TestLoadBundleViewStreamingViewReadsBackSameData(t *testing.T) {
+	path := writeGzippedBundle(t, streamingSizeThreshold+1024*1024)
+	view, err := loadBundleView(path)
+	if err != nil {
+		t.Fatalf("loadBundleView: %v", err)
+	}
+	defer closeView(view)
+
+	if _, ok := view.(*streamingView); !ok {
+		t.Fatalf("expected a *streamingView for a bundle over the threshold")
+	}
+
+	val, ok, err := view.Get("/v1/pad")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if !ok {
+		t.Fatalf("Get(/v1/pad) found=false, want true")
+	}
+	s, ok := val.(string)
+	if !ok || len(s) != streamingSizeThreshold+1024*1024 {
+		t.Errorf("Get(/v1/pad) length = %d, want %d", len(s), streamingSizeThreshold+1024*1024)
+	}
+}
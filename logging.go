@@ -0,0 +1,97 @@
+// logging.go
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// captureWriter wraps an http.ResponseWriter, tracking the status code and
+// total bytes written (and, optionally, a full copy of the body) so
+// middleware can report on the response after the handler returns.
+type captureWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+	tee    *strings.Builder // non-nil when the caller wants the full body retained
+}
+
+func newCaptureWriter(w http.ResponseWriter, captureBody bool) *captureWriter {
+	cw := &captureWriter{ResponseWriter: w, status: http.StatusOK}
+	if captureBody {
+		cw.tee = &strings.Builder{}
+	}
+	return cw
+}
+
+func (cw *captureWriter) WriteHeader(code int) {
+	cw.status = code
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *captureWriter) Write(p []byte) (int, error) {
+	n, err := cw.ResponseWriter.Write(p)
+	cw.bytes += n
+	if cw.tee != nil {
+		cw.tee.Write(p[:n])
+	}
+	return n, err
+}
+
+// Flush lets captureWriter sit underneath flushingWriter (used by
+// streamJSONArray) without losing the underlying Flusher.
+func (cw *captureWriter) Flush() {
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// withRequestLog replaces the ad-hoc log.Printf calls getKeysHandler and
+// getDataHandler used to make per-request, with a single structured
+// log/slog record per request.
+func withRequestLog(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		cw := newCaptureWriter(w, false)
+
+		next(cw, r)
+
+		key, bundleID := requestKeyAndBundle(r)
+		slog.Info("request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"key", key,
+			"query", r.URL.RawQuery,
+			"remote", r.RemoteAddr,
+			"status", cw.status,
+			"bytes", cw.bytes,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"bundle_id", bundleID,
+		)
+	}
+}
+
+// requestKeyAndBundle pulls the bundle id and /v1/* key out of a request,
+// whether it arrived as `?bundle=<id>` plus /api/data/<key> or as the
+// /api/bundles/{id}/data/{key} path form.
+func requestKeyAndBundle(r *http.Request) (key, bundleID string) {
+	bundleID = r.URL.Query().Get("bundle")
+	path := r.URL.Path
+
+	switch {
+	case strings.HasPrefix(path, "/api/data/"):
+		key, _ = decodePath(strings.TrimPrefix(path, "/api/data/"))
+	case strings.HasPrefix(path, "/api/bundles/"):
+		rest := strings.TrimPrefix(path, "/api/bundles/")
+		parts := strings.SplitN(rest, "/", 2)
+		if len(parts) == 2 {
+			bundleID = parts[0]
+			if strings.HasPrefix(parts[1], "data/") {
+				key, _ = decodePath(strings.TrimPrefix(parts[1], "data/"))
+			}
+		}
+	}
+	return key, bundleID
+}
@@ -2,103 +2,362 @@
 package main
 
 import (
-	"compress/gzip" // Correct standard library package
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"strings"
-	"sync"
+	"time"
+
+	"github.com/saurabhsadhalesuse/neuvector-analyser/auth"
 )
 
-// Global variable to store the parsed data
-var neuvectorData map[string]interface{}
-var dataMutex sync.RWMutex // Mutex to protect access to neuvectorData
+// frontendDir is the directory where your HTML/JS/CSS files reside.
+const frontendDir = "frontend"
+
+// usersFile and saltFile back the auth package's Store and per-install
+// Argon2id salt, respectively.
+const (
+	usersFile     = "users.json"
+	saltFile      = "auth.salt"
+	sessionTTL    = 24 * time.Hour
+	sessionCookie = "nv_session"
+)
 
-const supportBundlePath = "nvsupport_20250726184136.json.gz"
-const frontendDir = "frontend" // Directory where your HTML/JS/CSS files will reside
+// defaultRequestTimeout bounds how long a handler is allowed to run when
+// the caller doesn't supply its own `?timeout=` query parameter.
+const defaultRequestTimeout = 30 * time.Second
 
 func main() {
+	// `neuvector-analyser replay <file>` resends a request a Recorder
+	// captured earlier, and `neuvector-analyser adduser <username>`
+	// provisions users.json; neither starts the server.
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "replay":
+			if err := runReplay(os.Args[2:]); err != nil {
+				log.Fatalf("replay failed: %v", err)
+			}
+			return
+		case "adduser":
+			if err := runAddUser(os.Args[2:]); err != nil {
+				log.Fatalf("adduser failed: %v", err)
+			}
+			return
+		}
+	}
+
+	recordDir := flag.String("record", "", "directory to write replayable request recordings into (non-GET or filter-bearing requests only)")
+	flag.Parse()
+
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+
 	// Added a version log to confirm the running backend
-	log.Println("[INFO] NeuVector Support Bundle Viewer Backend (v1.2) starting...") // Updated version for clarity
+	log.Println("[INFO] NeuVector Support Bundle Viewer Backend (v2.1) starting...") // Updated version for clarity
 
-	// Load the data once when the server starts
-	if !loadData() {
-		log.Fatalf("Failed to load support bundle data from %s. Exiting.", supportBundlePath)
+	bm, err := NewBundleManager(defaultBundleDir)
+	if err != nil {
+		log.Fatalf("Failed to initialize bundle manager at %s: %v", defaultBundleDir, err)
+	}
+
+	if _, err := auth.LoadOrCreateSalt(saltFile); err != nil {
+		log.Fatalf("Failed to load auth salt from %s: %v", saltFile, err)
+	}
+	userStore, err := auth.NewStore(usersFile)
+	if err != nil {
+		log.Fatalf("Failed to load user store from %s: %v", usersFile, err)
+	}
+	sessions := auth.NewSessionManager(sessionTTL)
+
+	rec, err := NewRecorder(*recordDir)
+	if err != nil {
+		log.Fatalf("Failed to initialize request recorder at %s: %v", *recordDir, err)
+	}
+
+	// route wraps a handler with the middleware every /api/* route shares:
+	// structured request logging (outermost, so it sees the final status),
+	// optional replay recording, and the request deadline.
+	route := func(h http.HandlerFunc) http.HandlerFunc {
+		return withRequestLog(rec.Middleware(withTimeout(defaultRequestTimeout)(h)))
 	}
 
 	// Serve static files from the "frontend" directory
 	fs := http.FileServer(http.Dir(frontendDir))
 	http.Handle("/", fs) // Serves index.html by default if present
 
-	// API endpoint to get all top-level keys (with optional filtering)
-	http.HandleFunc("/api/keys", getKeysHandler)
-	// API endpoint to get data for a specific key
-	http.HandleFunc("/api/data/", getDataHandler)
+	// Auth endpoints: /api/login issues the session cookie, everything
+	// else under /api/ requires one.
+	http.HandleFunc("/api/login", route(loginHandler(userStore, sessions)))
+	http.HandleFunc("/api/logout", route(requireAuth(sessions)(logoutHandler(sessions))))
+	http.HandleFunc("/api/me", route(requireAuth(sessions)(meHandler)))
+
+	// Bundle workspace endpoints: list/upload, and per-bundle delete/keys/data.
+	http.HandleFunc("/api/bundles", route(requireAuth(sessions)(bundlesHandler(bm))))
+	http.HandleFunc("/api/bundles/", route(requireAuth(sessions)(bundleSubHandler(bm))))
+
+	// Legacy-shaped endpoints, now bundle-scoped via a `?bundle=<id>` query param.
+	http.HandleFunc("/api/keys", route(requireAuth(sessions)(func(w http.ResponseWriter, r *http.Request) {
+		getKeysHandler(bm, r.URL.Query().Get("bundle"), w, r)
+	})))
+	http.HandleFunc("/api/data/", route(requireAuth(sessions)(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.URL.Path, "/api/data/")
+		getDataHandler(bm, r.URL.Query().Get("bundle"), key, w, r)
+	})))
+
+	// Cross-bundle diff, e.g. pre-upgrade vs post-upgrade bundle comparison.
+	http.HandleFunc("/api/diff", route(requireAuth(sessions)(func(w http.ResponseWriter, r *http.Request) {
+		diffHandler(bm, w, r)
+	})))
+
+	server := &http.Server{
+		Addr:              ":8080",
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      60 * time.Second,
+		IdleTimeout:       120 * time.Second,
+	}
+	log.Printf("[INFO] Server listening on port %s", server.Addr)
+	log.Fatal(server.ListenAndServe())
+}
+
+// withTimeout derives a context.WithTimeout from the request, honoring a
+// `?timeout=<duration>` query parameter (e.g. "500ms", "5s") when present
+// and falling back to defaultTimeout otherwise. Handlers further down the
+// chain check ctx.Err() to abort large responses early instead of running
+// unbounded.
+func withTimeout(defaultTimeout time.Duration) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			d := defaultTimeout
+			if raw := r.URL.Query().Get("timeout"); raw != "" {
+				if parsed, err := time.ParseDuration(raw); err == nil {
+					d = parsed
+				}
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			next(w, r.WithContext(ctx))
+		}
+	}
+}
 
-	port := ":8080"
-	log.Printf("[INFO] Server listening on port %s", port)
-	log.Fatal(http.ListenAndServe(port, nil))
+// sessionUsernameKey is the context key requireAuth stashes the
+// authenticated username under for downstream handlers.
+type sessionUsernameKey struct{}
+
+// requireAuth gates an http.HandlerFunc behind a valid session cookie.
+// Support bundles contain sensitive cluster inventory, so every /api/*
+// route except /api/login is wrapped with this.
+func requireAuth(sessions *auth.SessionManager) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			cookie, err := r.Cookie(sessionCookie)
+			if err != nil {
+				http.Error(w, `{"error": "Not authenticated."}`, http.StatusUnauthorized)
+				return
+			}
+			sess, ok := sessions.Lookup(cookie.Value)
+			if !ok {
+				http.Error(w, `{"error": "Session expired or invalid."}`, http.StatusUnauthorized)
+				return
+			}
+			ctx := context.WithValue(r.Context(), sessionUsernameKey{}, sess.Username)
+			next(w, r.WithContext(ctx))
+		}
+	}
 }
 
-// loadData decompresses the gzipped JSON file and parses it into neuvectorData.
-func loadData() bool {
-	log.Printf("[INFO] Loading data from %s...", supportBundlePath)
+// loginCredentials is the POST /api/login request body.
+type loginCredentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
 
-	// Open the gzipped file
-	gzipFile, err := os.Open(supportBundlePath)
-	if err != nil {
-		log.Printf("[ERROR] Error opening gzipped file: %v\n", err)
-		return false
+// loginHandler handles POST /api/login: on success it sets a session
+// cookie and returns the username.
+func loginHandler(store *auth.Store, sessions *auth.SessionManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodPost {
+			http.Error(w, `{"error": "Method not allowed."}`, http.StatusMethodNotAllowed)
+			return
+		}
+
+		var creds loginCredentials
+		if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+			http.Error(w, `{"error": "Invalid login request body."}`, http.StatusBadRequest)
+			return
+		}
+
+		ok, err := store.Authenticate(creds.Username, creds.Password)
+		if err != nil {
+			log.Printf("[ERROR] Error authenticating user '%s': %v", creds.Username, err)
+			http.Error(w, `{"error": "Authentication failed."}`, http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, `{"error": "Invalid username or password."}`, http.StatusUnauthorized)
+			return
+		}
+
+		token, err := sessions.Create(creds.Username)
+		if err != nil {
+			log.Printf("[ERROR] Error creating session for user '%s': %v", creds.Username, err)
+			http.Error(w, `{"error": "Failed to create session."}`, http.StatusInternalServerError)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Value:    token,
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+			Expires:  time.Now().Add(sessionTTL),
+		})
+		json.NewEncoder(w).Encode(map[string]string{"username": creds.Username})
 	}
-	defer gzipFile.Close()
+}
 
-	// Create a gzip reader
-	gzr, err := gzip.NewReader(gzipFile)
-	if err != nil {
-		log.Printf("[ERROR] Error creating gzip reader: %v\n", err)
-		return false
+// logoutHandler handles POST /api/logout: it revokes the session token and
+// clears the cookie.
+func logoutHandler(sessions *auth.SessionManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if cookie, err := r.Cookie(sessionCookie); err == nil {
+			sessions.Revoke(cookie.Value)
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Value:    "",
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+			Expires:  time.Unix(0, 0),
+		})
+		json.NewEncoder(w).Encode(map[string]string{"status": "logged out"})
 	}
-	defer gzr.Close()
+}
 
-	// Read the decompressed data
-	decompressedData, err := ioutil.ReadAll(gzr)
+// meHandler handles GET /api/me: it returns the username of the
+// authenticated caller.
+func meHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username, _ := r.Context().Value(sessionUsernameKey{}).(string)
+	json.NewEncoder(w).Encode(map[string]string{"username": username})
+}
+
+// bundlesHandler lists (GET) or uploads (POST) support bundles.
+func bundlesHandler(bm *BundleManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			json.NewEncoder(w).Encode(bm.List())
+		case http.MethodPost:
+			uploadBundleHandler(bm, w, r)
+		default:
+			http.Error(w, `{"error": "Method not allowed."}`, http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// uploadBundleHandler handles POST /api/bundles, a multipart upload of a
+// single `*.json.gz` support bundle under the form field "bundle".
+func uploadBundleHandler(bm *BundleManager, w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBundleBytes)
+
+	file, header, err := r.FormFile("bundle")
 	if err != nil {
-		log.Printf("[ERROR] Error reading decompressed data: %v\n", err)
-		return false
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, fmt.Sprintf(`{"error": "Bundle exceeds the %d byte upload limit."}`, maxUploadBundleBytes), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, fmt.Sprintf(`{"error": "Missing bundle upload: %v"}`, err), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	if !strings.HasSuffix(strings.ToLower(header.Filename), ".json.gz") {
+		http.Error(w, `{"error": "Bundle must be a .json.gz file."}`, http.StatusBadRequest)
+		return
 	}
-	log.Printf("[INFO] Successfully decompressed. Content size: %d characters.\n", len(decompressedData))
 
-	// Unmarshal the JSON data
-	dataMutex.Lock() // Protect global data during write
-	err = json.Unmarshal(decompressedData, &neuvectorData)
-	dataMutex.Unlock()
+	meta, err := bm.Upload(header.Filename, file)
 	if err != nil {
-		log.Printf("[ERROR] Error parsing JSON data: %v\n", err)
-		return false
+		log.Printf("[ERROR] Error uploading bundle '%s': %v", header.Filename, err)
+		http.Error(w, fmt.Sprintf(`{"error": "Failed to store bundle: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(meta)
+}
+
+// bundleSubHandler routes /api/bundles/{id} (DELETE), /api/bundles/{id}/keys
+// (GET), and /api/bundles/{id}/data/{key} (GET).
+func bundleSubHandler(bm *BundleManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		rest := strings.TrimPrefix(r.URL.Path, "/api/bundles/")
+		parts := strings.SplitN(rest, "/", 2)
+		id := parts[0]
+		if id == "" {
+			http.Error(w, `{"error": "Bundle id required."}`, http.StatusBadRequest)
+			return
+		}
+
+		if len(parts) == 1 {
+			if r.Method != http.MethodDelete {
+				http.Error(w, `{"error": "Method not allowed."}`, http.StatusMethodNotAllowed)
+				return
+			}
+			if err := bm.Delete(id); err != nil {
+				http.Error(w, fmt.Sprintf(`{"error": "Bundle '%s' not found."}`, id), http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		sub := parts[1]
+		switch {
+		case sub == "keys":
+			getKeysHandler(bm, id, w, r)
+		case strings.HasPrefix(sub, "data/"):
+			key := strings.TrimPrefix(sub, "data/")
+			getDataHandler(bm, id, key, w, r)
+		default:
+			http.Error(w, `{"error": "Unknown bundle sub-resource."}`, http.StatusNotFound)
+		}
 	}
-	log.Println("[INFO] Successfully parsed content as JSON.")
-	return true
 }
 
-// getKeysHandler returns a list of top-level keys, optionally filtered by a query parameter.
-func getKeysHandler(w http.ResponseWriter, r *http.Request) {
+// getKeysHandler returns a list of top-level keys for the given bundle,
+// optionally filtered by a query parameter.
+func getKeysHandler(bm *BundleManager, bundleID string, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	dataMutex.RLock() // Protect global data during read
-	defer dataMutex.RUnlock()
 
-	if neuvectorData == nil || len(neuvectorData) == 0 {
-		http.Error(w, `{"error": "Data not loaded."}`, http.StatusInternalServerError)
+	if bundleID == "" {
+		http.Error(w, `{"error": "Missing 'bundle' id."}`, http.StatusBadRequest)
 		return
 	}
 
-	allKeys := make([]string, 0, len(neuvectorData))
-	for key := range neuvectorData {
-		allKeys = append(allKeys, key)
+	view, err := bm.View(bundleID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "Bundle '%s' not found."}`, bundleID), http.StatusNotFound)
+		return
 	}
 
+	allKeys := view.Keys()
+
 	// Implement filtering based on 'q' query parameter
 	query := r.URL.Query().Get("q")
 	if query != "" {
@@ -115,13 +374,17 @@ func getKeysHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(allKeys)
 }
 
-// getDataHandler returns the JSON content for a specific key, with filtering for /v1/group, /v1/domain, and /v1/host.
-func getDataHandler(w http.ResponseWriter, r *http.Request) {
+// getDataHandler returns the JSON content for a specific key in the given
+// bundle, with filtering for /v1/group, /v1/domain, /v1/scan/platform, and
+// /v1/host.
+func getDataHandler(bm *BundleManager, bundleID string, key string, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	dataMutex.RLock() // Protect global data during read
-	defer dataMutex.RUnlock()
 
-	key := strings.TrimPrefix(r.URL.Path, "/api/data/")
+	if bundleID == "" {
+		http.Error(w, `{"error": "Missing 'bundle' id."}`, http.StatusBadRequest)
+		return
+	}
+
 	key, err := decodePath(key)
 	if err != nil {
 		log.Printf("[ERROR] Error decoding key path '%s': %v", r.URL.Path, err)
@@ -129,258 +392,239 @@ func getDataHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("[INFO] Processing request for key: '%s'", key)
+	ctx := r.Context()
 
-	if neuvectorData == nil || len(neuvectorData) == 0 {
-		http.Error(w, `{"error": "Data not loaded."}`, http.StatusInternalServerError)
+	view, err := bm.View(bundleID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "Bundle '%s' not found."}`, bundleID), http.StatusNotFound)
 		return
 	}
 
-	val, ok := neuvectorData[key]
-	if !ok {
-		http.Error(w, fmt.Sprintf(`{"error": "Key '%s' not found."}`, key), http.StatusNotFound)
+	// --- Special handling for /v1/group, /v1/scan/platform, /v1/domain,
+	// and /v1/host: stream the inner array straight off the bundle view
+	// (token-by-token for a streamingView) instead of decoding the whole
+	// key and materializing the array to filter it in memory. ---
+	switch key {
+	case "/v1/group":
+		filterZeroDriftStr := r.URL.Query().Get("zero_drift")
+		filterDomain := r.URL.Query().Get("domain") // Keep original case for domain filter
+		filterPolicyMode := strings.ToLower(r.URL.Query().Get("policy_mode"))
+
+		streamArrayField(ctx, view, bundleID, key, "groups", w, func(group map[string]interface{}) (interface{}, bool) {
+			groupName, _ := group["name"].(string)
+
+			if strings.HasPrefix(groupName, "_") { // Filter out groups starting with '_'
+				return nil, false
+			}
+
+			if filterZeroDriftStr != "" {
+				zeroDriftEnabled, hasZeroDrift := group["zero_drift_enabled"].(bool)
+				if !hasZeroDrift {
+					zeroDriftEnabled = false
+				}
+				if filterZeroDriftStr == "true" && !zeroDriftEnabled {
+					return nil, false
+				}
+				if filterZeroDriftStr == "false" && zeroDriftEnabled {
+					return nil, false
+				}
+			}
+
+			if filterDomain != "" {
+				groupDomain, hasDomain := group["domain"].(string)
+				if !hasDomain {
+					groupDomain = ""
+				}
+				if !strings.Contains(strings.ToLower(groupDomain), strings.ToLower(filterDomain)) {
+					return nil, false
+				}
+			}
+
+			if filterPolicyMode != "" {
+				groupPolicyMode, hasPolicyMode := group["policy_mode"].(string)
+				if !hasPolicyMode {
+					groupPolicyMode = ""
+				}
+				if strings.ToLower(groupPolicyMode) != filterPolicyMode {
+					return nil, false
+				}
+			}
+
+			return group, true
+		})
 		return
-	}
 
-	// --- Special handling for /v1/group with filters ---
-	if key == "/v1/group" {
-		if valMap, isMap := val.(map[string]interface{}); isMap {
-			if groupsIface, hasGroupsKey := valMap["groups"]; hasGroupsKey {
-				if groups, isArray := groupsIface.([]interface{}); isArray {
-					filteredGroups := []interface{}{}
-
-					// Get filter parameters from query string
-					filterZeroDriftStr := r.URL.Query().Get("zero_drift")
-					filterDomain := r.URL.Query().Get("domain") // Keep original case for domain filter
-					filterPolicyMode := strings.ToLower(r.URL.Query().Get("policy_mode"))
-
-					for _, groupIface := range groups {
-						group := groupIface.(map[string]interface{})
-
-						groupName, _ := group["name"].(string)
-
-						// --- Filtering logic ---
-						if strings.HasPrefix(groupName, "_") { // Filter out groups starting with '_'
-							continue
-						}
-
-						if filterZeroDriftStr != "" {
-							zeroDriftEnabled, hasZeroDrift := group["zero_drift_enabled"].(bool)
-							if !hasZeroDrift {
-								zeroDriftEnabled = false
-							}
-							if filterZeroDriftStr == "true" && !zeroDriftEnabled {
-								continue
-							}
-							if filterZeroDriftStr == "false" && zeroDriftEnabled {
-								continue
-							}
-						}
-
-						if filterDomain != "" {
-							groupDomain, hasDomain := group["domain"].(string)
-							if !hasDomain {
-								groupDomain = ""
-							}
-							lowerGroupDomain := strings.ToLower(groupDomain)
-							if !strings.Contains(lowerGroupDomain, strings.ToLower(filterDomain)) {
-								continue
-							}
-						}
-
-						if filterPolicyMode != "" {
-							groupPolicyMode, hasPolicyMode := group["policy_mode"].(string)
-							if !hasPolicyMode {
-								groupPolicyMode = ""
-							}
-							lowerGroupPolicyMode := strings.ToLower(groupPolicyMode)
-							if lowerGroupPolicyMode != filterPolicyMode {
-								continue
-							}
-						}
-						// --- End Filtering logic ---
-
-						filteredGroups = append(filteredGroups, group)
+	case "/v1/scan/platform":
+		streamArrayField(ctx, view, bundleID, key, "platforms", w, func(platformMap map[string]interface{}) (interface{}, bool) {
+			newPlatform := make(map[string]interface{})
+			newPlatform["platform"] = platformMap["platform"]
+			newPlatform["status"] = platformMap["status"]
+
+			versionToUse := ""
+			if platformName, ok := platformMap["platform"].(string); ok {
+				if strings.Contains(strings.ToLower(platformName), "openshift") {
+					if ov, ok := platformMap["openshift_version"].(string); ok {
+						versionToUse = ov
 					}
-					json.NewEncoder(w).Encode(filteredGroups)
-					return
 				} else {
-					log.Printf("[ERROR] Expected 'groups' key to be an array for /v1/group, but got %T. Keys found: %v", groupsIface, getMapKeys(valMap))
+					if kv, ok := platformMap["kube_version"].(string); ok {
+						versionToUse = kv
+					}
 				}
 			} else {
-				log.Printf("[ERROR] Key '/v1/group' data is a map, but does not contain a 'groups' key. Keys found: %v", getMapKeys(valMap))
+				if v, ok := platformMap["version"].(string); ok {
+					versionToUse = v
+				}
 			}
-		} else {
-			log.Printf("[ERROR] Expected '/v1/group' data to be a map, but got %T. Cannot apply group filters.", val)
-		}
-	} else if key == "/v1/scan/platform" { // Handle /v1/scan/platform
-		if valMap, isMap := val.(map[string]interface{}); isMap {
-			if platformsIface, hasPlatformsKey := valMap["platforms"]; hasPlatformsKey {
-				if platforms, isArray := platformsIface.([]interface{}); isArray {
-					formattedPlatforms := []map[string]interface{}{}
-					for _, platformIface := range platforms {
-						if platformMap, isPlatformMap := platformIface.(map[string]interface{}); isPlatformMap {
-							newPlatform := make(map[string]interface{})
-							newPlatform["platform"] = platformMap["platform"]
-							newPlatform["status"] = platformMap["status"]
-
-							versionToUse := ""
-							if platformName, ok := platformMap["platform"].(string); ok {
-								if strings.Contains(strings.ToLower(platformName), "openshift") {
-									if ov, ok := platformMap["openshift_version"].(string); ok {
-										versionToUse = ov
-									}
-								} else {
-									if kv, ok := platformMap["kube_version"].(string); ok {
-										versionToUse = kv
-									}
-								}
-							} else {
-								if v, ok := platformMap["version"].(string); ok {
-									versionToUse = v
-								}
-							}
-							newPlatform["version"] = versionToUse
-
-							if scanSummaryIface, hasScanSummary := platformMap["scan_summary"]; hasScanSummary {
-								if scanSummaryMap, isScanSummaryMap := scanSummaryIface.(map[string]interface{}); isScanSummaryMap {
-									newPlatform["high"] = scanSummaryMap["high"]
-									newPlatform["medium"] = scanSummaryMap["medium"]
-									newPlatform["scanned_at"] = scanSummaryMap["scanned_at"]
-								}
-							}
-							formattedPlatforms = append(formattedPlatforms, newPlatform)
-						}
-					}
-					json.NewEncoder(w).Encode(formattedPlatforms)
-					return
-				} else {
-					log.Printf("[ERROR] Expected 'platforms' key to be an array for /v1/scan/platform, but got %T", platformsIface)
+			newPlatform["version"] = versionToUse
+
+			if scanSummaryIface, hasScanSummary := platformMap["scan_summary"]; hasScanSummary {
+				if scanSummaryMap, isScanSummaryMap := scanSummaryIface.(map[string]interface{}); isScanSummaryMap {
+					newPlatform["high"] = scanSummaryMap["high"]
+					newPlatform["medium"] = scanSummaryMap["medium"]
+					newPlatform["scanned_at"] = scanSummaryMap["scanned_at"]
 				}
-			} else {
-				log.Printf("[ERROR] Key '/v1/scan/platform' data is a map, but does not contain a 'platforms' key. Keys found: %v", getMapKeys(valMap))
 			}
-		} else {
-			log.Printf("[ERROR] Expected '/v1/scan/platform' data to be a map, but got %T", val)
-		}
-		http.Error(w, `{"error": "Failed to process platform data."}`, http.StatusInternalServerError)
+			return newPlatform, true
+		})
 		return
-	} else if key == "/v1/domain" { // Handle /v1/domain for Namespaces
-		if valMap, isMap := val.(map[string]interface{}); isMap {
-			if domainsIface, hasDomainsKey := valMap["domains"]; hasDomainsKey {
-				if domains, isArray := domainsIface.([]interface{}); isArray {
-					formattedDomains := []map[string]interface{}{}
-
-					filterName := r.URL.Query().Get("domain") // Get the filter parameter for domain name
-
-					for _, domainIface := range domains {
-						if domainMap, isDomainMap := domainIface.(map[string]interface{}); isDomainMap {
-							domainName, _ := domainMap["name"].(string)
-
-							// --- Filter out domains starting with '_' ---
-							if strings.HasPrefix(domainName, "_") {
-								continue // Skip domains starting with '_'
-							}
-							// --- End Filter out domains starting with '_' ---
-
-							// --- Apply name filter if present ---
-							if filterName != "" {
-								if !strings.Contains(strings.ToLower(domainName), strings.ToLower(filterName)) {
-									continue // Skip if domain name doesn't match filter
-								}
-							}
-							// --- End Apply name filter ---
-
-							newDomain := make(map[string]interface{})
-							newDomain["name"] = domainMap["name"]
-							newDomain["workloads"] = domainMap["workloads"]
-							newDomain["running_workloads"] = domainMap["running_workloads"]
-							newDomain["running_pods"] = domainMap["running_pods"]
-							newDomain["services"] = domainMap["services"]
-
-							formattedDomains = append(formattedDomains, newDomain)
-						}
-					}
-					json.NewEncoder(w).Encode(formattedDomains)
-					return
-				} else {
-					log.Printf("[ERROR] Expected 'domains' key to be an array for /v1/domain, but got %T", domainsIface)
+
+	case "/v1/domain":
+		filterName := r.URL.Query().Get("domain") // Get the filter parameter for domain name
+
+		streamArrayField(ctx, view, bundleID, key, "domains", w, func(domainMap map[string]interface{}) (interface{}, bool) {
+			domainName, _ := domainMap["name"].(string)
+
+			if strings.HasPrefix(domainName, "_") { // Filter out domains starting with '_'
+				return nil, false
+			}
+
+			if filterName != "" {
+				if !strings.Contains(strings.ToLower(domainName), strings.ToLower(filterName)) {
+					return nil, false // Skip if domain name doesn't match filter
 				}
-			} else {
-				log.Printf("[ERROR] Key '/v1/domain' data is a map, but does not contain a 'domains' key. Keys found: %v", getMapKeys(valMap))
 			}
-		} else {
-			log.Printf("[ERROR] Expected '/v1/domain' data to be a map, but got %T", val)
-		}
-		http.Error(w, `{"error": "Failed to process domain data."}`, http.StatusInternalServerError)
+
+			newDomain := make(map[string]interface{})
+			newDomain["name"] = domainMap["name"]
+			newDomain["workloads"] = domainMap["workloads"]
+			newDomain["running_workloads"] = domainMap["running_workloads"]
+			newDomain["running_pods"] = domainMap["running_pods"]
+			newDomain["services"] = domainMap["services"]
+
+			return newDomain, true
+		})
 		return
-	} else if key == "/v1/host" { // Handle /v1/host for Nodes
-		if valMap, isMap := val.(map[string]interface{}); isMap {
-			if hostsIface, hasHostsKey := valMap["hosts"]; hasHostsKey { // Assuming "hosts" key contains the array
-				if hosts, isArray := hostsIface.([]interface{}); isArray {
-					formattedHosts := []map[string]interface{}{}
-
-					filterName := r.URL.Query().Get("domain") // Reusing 'domain' filter param for host 'name'
-
-					for _, hostIface := range hosts {
-						if hostMap, isHostMap := hostIface.(map[string]interface{}); isHostMap {
-							hostName, _ := hostMap["name"].(string)
-
-							// Apply name filter if present
-							if filterName != "" {
-								if !strings.Contains(strings.ToLower(hostName), strings.ToLower(filterName)) {
-									continue // Skip if host name doesn't match filter
-								}
-							}
-
-							newHost := make(map[string]interface{})
-							newHost["name"] = hostMap["name"]
-							newHost["state"] = hostMap["state"]
-							newHost["os"] = hostMap["os"]
-							newHost["platform"] = hostMap["platform"]
-							newHost["containers"] = hostMap["containers"] // Assuming this is a direct count or array
-
-							if scanSummaryIface, hasScanSummary := hostMap["scan_summary"]; hasScanSummary {
-								if scanSummaryMap, isScanSummaryMap := scanSummaryIface.(map[string]interface{}); isScanSummaryMap {
-									newHost["scan_status"] = scanSummaryMap["status"] // Map scan_summary.status to Scan Status
-									newHost["high"] = scanSummaryMap["high"]
-									newHost["medium"] = scanSummaryMap["medium"]
-									newHost["scanned_at"] = scanSummaryMap["scanned_at"]
-								}
-							}
-							formattedHosts = append(formattedHosts, newHost)
-						}
-					}
-					json.NewEncoder(w).Encode(formattedHosts)
-					return
-				} else {
-					log.Printf("[ERROR] Expected 'hosts' key to be an array for /v1/host, but got %T", hostsIface)
+
+	case "/v1/host":
+		filterName := r.URL.Query().Get("domain") // Reusing 'domain' filter param for host 'name'
+
+		streamArrayField(ctx, view, bundleID, key, "hosts", w, func(hostMap map[string]interface{}) (interface{}, bool) {
+			hostName, _ := hostMap["name"].(string)
+
+			if filterName != "" {
+				if !strings.Contains(strings.ToLower(hostName), strings.ToLower(filterName)) {
+					return nil, false // Skip if host name doesn't match filter
 				}
-			} else {
-				log.Printf("[ERROR] Key '/v1/host' data is a map, but does not contain a 'hosts' key. Keys found: %v", getMapKeys(valMap))
 			}
-		} else {
-			log.Printf("[ERROR] Expected '/v1/host' data to be a map, but got %T", val)
-		}
-		http.Error(w, `{"error": "Failed to process host data."}`, http.StatusInternalServerError)
+
+			newHost := make(map[string]interface{})
+			newHost["name"] = hostMap["name"]
+			newHost["state"] = hostMap["state"]
+			newHost["os"] = hostMap["os"]
+			newHost["platform"] = hostMap["platform"]
+			newHost["containers"] = hostMap["containers"] // Assuming this is a direct count or array
+
+			if scanSummaryIface, hasScanSummary := hostMap["scan_summary"]; hasScanSummary {
+				if scanSummaryMap, isScanSummaryMap := scanSummaryIface.(map[string]interface{}); isScanSummaryMap {
+					newHost["scan_status"] = scanSummaryMap["status"] // Map scan_summary.status to Scan Status
+					newHost["high"] = scanSummaryMap["high"]
+					newHost["medium"] = scanSummaryMap["medium"]
+					newHost["scanned_at"] = scanSummaryMap["scanned_at"]
+				}
+			}
+			return newHost, true
+		})
 		return
 	}
 
 	// Default behavior for other keys
+	val, ok, err := view.Get(key)
+	if err != nil {
+		log.Printf("[ERROR] Error decoding key '%s' for bundle '%s': %v", key, bundleID, err)
+		http.Error(w, fmt.Sprintf(`{"error": "Failed to decode key '%s': %v"}`, key, err), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, fmt.Sprintf(`{"error": "Key '%s' not found."}`, key), http.StatusNotFound)
+		return
+	}
 	json.NewEncoder(w).Encode(val)
 }
 
+// diffHandler serves GET /api/diff?left=<bundleId>&right=<bundleId>&key=/v1/group
+// (and the other specialized keys), returning the added/removed/changed
+// entries between the two bundles' arrays for that key.
+func diffHandler(bm *BundleManager, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	leftID := r.URL.Query().Get("left")
+	rightID := r.URL.Query().Get("right")
+	key := r.URL.Query().Get("key")
+
+	if leftID == "" || rightID == "" || key == "" {
+		http.Error(w, `{"error": "Query params 'left', 'right', and 'key' are required."}`, http.StatusBadRequest)
+		return
+	}
+
+	spec, ok := diffSpecs[key]
+	if !ok {
+		http.Error(w, fmt.Sprintf(`{"error": "Diff is not supported for key '%s'."}`, key), http.StatusBadRequest)
+		return
+	}
+
+	leftItems, err := diffableArray(bm, leftID, key, spec)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusNotFound)
+		return
+	}
+	rightItems, err := diffableArray(bm, rightID, key, spec)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(diffSlicesByKey(leftItems, rightItems, spec.idField))
+}
+
+// diffableArray fetches a bundle and unwraps the array for the given key
+// (e.g. /v1/group's "groups" list), the same shape getDataHandler's
+// specialized branches already expect.
+func diffableArray(bm *BundleManager, bundleID, key string, spec diffSpec) ([]interface{}, error) {
+	view, err := bm.View(bundleID)
+	if err != nil {
+		return nil, fmt.Errorf("bundle '%s' not found", bundleID)
+	}
+	val, ok, err := view.Get(key)
+	if err != nil {
+		return nil, fmt.Errorf("bundle '%s' key '%s': %w", bundleID, key, err)
+	}
+	if !ok {
+		return nil, fmt.Errorf("bundle '%s' has no key '%s'", bundleID, key)
+	}
+	valMap, ok := val.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("bundle '%s' key '%s' is not an object", bundleID, key)
+	}
+	items, ok := valMap[spec.arrayField].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("bundle '%s' key '%s' has no '%s' array", bundleID, key, spec.arrayField)
+	}
+	return items, nil
+}
+
 // decodePath decodes URL-encoded path segments.
 func decodePath(path string) (string, error) {
 	decoded := strings.ReplaceAll(path, "%2F", "/")
 	return decoded, nil
 }
-
-// getMapKeys extracts keys from a map[string]interface{} for logging
-func getMapKeys(m map[string]interface{}) []string {
-	keys := make([]string, 0, len(m))
-	for k := range m {
-		keys = append(keys, k)
-	}
-	return keys
-}
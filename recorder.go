@@ -0,0 +1,280 @@
+// recorder.go
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// maxRecordedBodyBytes caps how much of a request body Recorder buffers
+// into a recording, so a large multipart bundle upload can't be read
+// entirely into memory just because -record is on.
+const maxRecordedBodyBytes = 64 * 1024
+
+// redactedHeaders lists request headers whose values carry live
+// credentials (a session cookie, a bearer token) and must never be
+// written to a recording file.
+var redactedHeaders = map[string]bool{
+	"Cookie":        true,
+	"Authorization": true,
+}
+
+// redactedBodyFields lists JSON body fields (e.g. /api/login's password)
+// to scrub before a body is persisted.
+var redactedBodyFields = []string{"password"}
+
+// recordedRequest is the on-disk shape written by Recorder and read back by
+// the `replay` subcommand. It captures enough of a non-GET or
+// filter-bearing request to resend it against a (possibly different)
+// bundle.
+type recordedRequest struct {
+	Timestamp time.Time           `json:"timestamp"`
+	Method    string              `json:"method"`
+	Path      string              `json:"path"`
+	Query     map[string][]string `json:"query"`
+	Headers   map[string][]string `json:"headers"`
+
+	// Body is base64-encoded (request bodies aren't guaranteed valid
+	// UTF-8, and a gzip/multipart upload certainly isn't) and redacted
+	// of any sensitive JSON fields. BodyOmitted explains when it's
+	// empty because no body was captured at all, rather than the
+	// request simply having none.
+	Body          string `json:"body,omitempty"`
+	BodyTruncated bool   `json:"body_truncated,omitempty"`
+	BodyOmitted   string `json:"body_omitted,omitempty"`
+
+	Status       int    `json:"status"`
+	ResponseHash string `json:"response_sha256"`
+}
+
+// Recorder writes a recordedRequest file for every request shouldRecord
+// selects, so a filter combination that triggered a bug can be replayed
+// later with `neuvector-analyser replay <file>`.
+type Recorder struct {
+	dir string
+	seq uint64
+}
+
+// NewRecorder creates a Recorder writing into dir, creating it if needed.
+// A zero-value *Recorder (dir == "") is valid and records nothing, so
+// callers can construct one unconditionally from an optional -record flag.
+func NewRecorder(dir string) (*Recorder, error) {
+	if dir == "" {
+		return &Recorder{}, nil
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("creating record dir %s: %w", dir, err)
+	}
+	return &Recorder{dir: dir}, nil
+}
+
+// shouldRecord reports whether r is worth recording: a non-GET request
+// (uploads, logins, deletes) or a GET carrying filter query parameters.
+func (rec *Recorder) shouldRecord(r *http.Request) bool {
+	if rec == nil || rec.dir == "" {
+		return false
+	}
+	return r.Method != http.MethodGet || len(r.URL.Query()) > 0
+}
+
+// redactHeaders copies h, replacing any header in redactedHeaders with a
+// placeholder so session cookies and bearer tokens never reach disk.
+func redactHeaders(h http.Header) map[string][]string {
+	out := make(map[string][]string, len(h))
+	for k, vs := range h {
+		if redactedHeaders[http.CanonicalHeaderKey(k)] {
+			out[k] = []string{"[redacted]"}
+			continue
+		}
+		out[k] = vs
+	}
+	return out
+}
+
+// redactJSONBody scrubs redactedBodyFields out of a JSON object body
+// (e.g. /api/login's plaintext password). Non-JSON or non-object bodies
+// are returned unchanged.
+func redactJSONBody(raw []byte) []byte {
+	var m map[string]interface{}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return raw
+	}
+
+	redacted := false
+	for _, field := range redactedBodyFields {
+		if _, ok := m[field]; ok {
+			m[field] = "[redacted]"
+			redacted = true
+		}
+	}
+	if !redacted {
+		return raw
+	}
+
+	out, err := json.Marshal(m)
+	if err != nil {
+		return raw
+	}
+	return out
+}
+
+// Middleware wraps next, writing a recordedRequest file for every request
+// shouldRecord selects. It's a no-op pass-through otherwise.
+func (rec *Recorder) Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !rec.shouldRecord(r) {
+			next(w, r)
+			return
+		}
+
+		entry := recordedRequest{
+			Method:  r.Method,
+			Path:    r.URL.Path,
+			Query:   map[string][]string(r.URL.Query()),
+			Headers: redactHeaders(r.Header),
+		}
+
+		switch {
+		case r.Body == nil:
+			// No body to capture.
+		case strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/"):
+			// A support bundle upload: potentially huge and binary, so
+			// never buffer it into memory just to record it.
+			entry.BodyOmitted = "multipart request body omitted from recording"
+		default:
+			captured, err := io.ReadAll(io.LimitReader(r.Body, maxRecordedBodyBytes+1))
+			if err != nil {
+				entry.BodyOmitted = fmt.Sprintf("reading request body: %v", err)
+				break
+			}
+			r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(captured), r.Body))
+
+			if len(captured) > maxRecordedBodyBytes {
+				captured = captured[:maxRecordedBodyBytes]
+				entry.BodyTruncated = true
+			} else {
+				captured = redactJSONBody(captured)
+			}
+			entry.Body = base64.StdEncoding.EncodeToString(captured)
+		}
+
+		cw := newCaptureWriter(w, true)
+		next(cw, r)
+
+		entry.Timestamp = time.Now()
+		entry.Status = cw.status
+		sum := sha256.Sum256([]byte(cw.tee.String()))
+		entry.ResponseHash = hex.EncodeToString(sum[:])
+
+		if err := rec.save(entry); err != nil {
+			slog.Error("recording request", "error", err)
+		}
+	}
+}
+
+// save writes entry to a new file under rec.dir, named so replays sort in
+// the order they were captured. Recordings can contain (redacted, but
+// still sensitive) request headers, so they're written private like
+// users.json and auth.salt.
+func (rec *Recorder) save(entry recordedRequest) error {
+	n := atomic.AddUint64(&rec.seq, 1)
+	name := fmt.Sprintf("%d-%04d.json", entry.Timestamp.Unix(), n)
+
+	raw, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding recorded request: %w", err)
+	}
+	return ioutil.WriteFile(filepath.Join(rec.dir, name), raw, 0o600)
+}
+
+// replayFlagSet defines the flags accepted by `neuvector-analyser replay`.
+func replayFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.String("addr", "http://localhost:8080", "base URL of the running server to replay the request against")
+	return fs
+}
+
+// runReplay implements `neuvector-analyser replay <file> [-addr <base-url>]`:
+// it reads a file written by Recorder and resends the captured request
+// against a running server, printing the response status and body so a
+// filter bug can be reproduced against a different bundle.
+func runReplay(args []string) error {
+	fs := replayFlagSet()
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: neuvector-analyser replay <file> [-addr http://host:port]")
+	}
+	addr := fs.Lookup("addr").Value.String()
+
+	raw, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("reading recorded request: %w", err)
+	}
+	var entry recordedRequest
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return fmt.Errorf("parsing recorded request: %w", err)
+	}
+	if entry.BodyOmitted != "" {
+		fmt.Printf("warning: %s; replaying without a body\n", entry.BodyOmitted)
+	}
+	if entry.BodyTruncated {
+		fmt.Println("warning: recorded body was truncated when captured; replay will be partial")
+	}
+
+	body, err := base64.StdEncoding.DecodeString(entry.Body)
+	if err != nil {
+		return fmt.Errorf("decoding recorded body: %w", err)
+	}
+
+	u := strings.TrimRight(addr, "/") + entry.Path
+	if len(entry.Query) > 0 {
+		q := make(url.Values, len(entry.Query))
+		for k, vs := range entry.Query {
+			q[k] = vs
+		}
+		u += "?" + q.Encode()
+	}
+
+	req, err := http.NewRequest(entry.Method, u, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("building replay request: %w", err)
+	}
+	for k, vs := range entry.Headers {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("replaying request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading replay response: %w", err)
+	}
+
+	fmt.Printf("originally recorded: %s %s -> status %d\n", entry.Method, entry.Path, entry.Status)
+	fmt.Printf("replayed against %s -> status %d\n", addr, resp.StatusCode)
+	fmt.Println(string(respBody))
+	return nil
+}
@@ -0,0 +1,120 @@
+// streaming.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// flushingWriter flushes the underlying ResponseWriter after every Write,
+// so a client streaming a large /v1/group or /v1/host response sees
+// elements as they're produced instead of waiting for the whole array.
+type flushingWriter struct {
+	w http.ResponseWriter
+}
+
+func (fw flushingWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	if f, ok := fw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return n, err
+}
+
+// jsonArrayWriter writes a JSON array to w incrementally as items are
+// pushed to it via Emit, flushing after each one. Unlike building a
+// []interface{} and json.Marshal-ing it in one shot, this doesn't require
+// knowing the element count (or holding every element) up front -- the
+// shape bundleView.GetArrayField streams elements in.
+type jsonArrayWriter struct {
+	fw    flushingWriter
+	wrote bool
+}
+
+func newJSONArrayWriter(w http.ResponseWriter) (*jsonArrayWriter, error) {
+	aw := &jsonArrayWriter{fw: flushingWriter{w: w}}
+	if _, err := aw.fw.Write([]byte("[")); err != nil {
+		return nil, err
+	}
+	return aw, nil
+}
+
+func (aw *jsonArrayWriter) Emit(v interface{}) error {
+	if aw.wrote {
+		if _, err := aw.fw.Write([]byte(",")); err != nil {
+			return err
+		}
+	}
+	aw.wrote = true
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("marshaling element: %w", err)
+	}
+	_, err = aw.fw.Write(b)
+	return err
+}
+
+func (aw *jsonArrayWriter) Close() error {
+	_, err := aw.fw.Write([]byte("]"))
+	return err
+}
+
+// streamArrayField streams the array at key's arrayField out of view
+// (e.g. /v1/group's "groups") as a JSON array, calling transform on every
+// decoded element to filter (returning ok=false to skip it) and reshape
+// it. Because it's built on bundleView.GetArrayField, a streamingView
+// bundle never has the full array in memory at once, and ctx cancellation
+// (from withTimeout) stops iteration between elements.
+//
+// The shape is validated via HasArrayField before anything is written to
+// w: once newJSONArrayWriter writes the opening '[' it's committed the
+// response to a 200, so a missing key or malformed array must be caught
+// ahead of that, not discovered mid-stream.
+func streamArrayField(ctx context.Context, view bundleView, bundleID, key, arrayField string, w http.ResponseWriter, transform func(item map[string]interface{}) (interface{}, bool)) {
+	if err := view.HasArrayField(key, arrayField); err != nil {
+		if errors.Is(err, errKeyNotFound) {
+			http.Error(w, fmt.Sprintf(`{"error": "Key '%s' not found."}`, key), http.StatusNotFound)
+			return
+		}
+		log.Printf("[ERROR] Validating '%s' for bundle '%s': %v", key, bundleID, err)
+		http.Error(w, fmt.Sprintf(`{"error": "Failed to process %s data: %v"}`, key, err), http.StatusInternalServerError)
+		return
+	}
+
+	aw, err := newJSONArrayWriter(w)
+	if err != nil {
+		log.Printf("[ERROR] Starting streamed response for bundle '%s' key '%s': %v", bundleID, key, err)
+		return
+	}
+
+	found, err := view.GetArrayField(ctx, key, arrayField, func(el interface{}) (bool, error) {
+		item, ok := el.(map[string]interface{})
+		if !ok {
+			return true, nil
+		}
+		out, keep := transform(item)
+		if !keep {
+			return true, nil
+		}
+		if err := aw.Emit(out); err != nil {
+			return false, err
+		}
+		return true, nil
+	})
+
+	if closeErr := aw.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Printf("[ERROR] Aborted streaming '%s' response for bundle '%s': %v", key, bundleID, err)
+		return
+	}
+	if !found {
+		log.Printf("[ERROR] Key '%s' has no '%s' array for bundle '%s'", key, arrayField, bundleID)
+	}
+}